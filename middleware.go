@@ -1,17 +1,38 @@
 package staticgzip
 
 import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// errNotAcceptable is returned by openFile when the client's Accept-Encoding
+// header explicitly rejects every content-coding the middleware could serve.
+var errNotAcceptable = errors.New("staticgzip: no acceptable content-coding")
+
+// errSecurityViolation wraps errors returned by safeOpen when a path
+// resolves (through a symlink) outside the configured Root.
+var errSecurityViolation = errors.New("staticgzip: resolved path escapes root")
+
 type (
 	// StaticConfig defines the config for Static middleware.
 	StaticConfig struct {
@@ -22,6 +43,13 @@ type (
 		// Required.
 		Root string `yaml:"root"`
 
+		// Filesystem to serve the static content from, instead of the OS
+		// filesystem rooted at Root. This allows assets bundled via
+		// `//go:embed` (wrapped with `http.FS`), in-memory filesystems or
+		// any other `http.FileSystem` implementation to be served.
+		// Optional. Defaults to `http.Dir(Root)`.
+		Filesystem http.FileSystem `yaml:"-"`
+
 		// Index file for serving a directory.
 		// Optional. Default value "index.html".
 		Index string `yaml:"index"`
@@ -42,9 +70,158 @@ type (
 		// the filesystem path is not doubled
 		// Optional. Default value false.
 		IgnoreBase bool `yaml:"ignoreBase"`
+
+		// CacheControl, when set, is sent as the `Cache-Control` header for
+		// every served file. Useful for fingerprinted assets, e.g.
+		// "public, max-age=31536000, immutable".
+		// Optional. Default value "" (no header is sent).
+		CacheControl string `yaml:"cacheControl"`
+
+		// ETagCacheSize bounds the number of computed ETags this instance
+		// keeps in its LRU cache.
+		// Optional. Default value defaultETagCacheSize.
+		ETagCacheSize int `yaml:"etagCacheSize"`
+
+		// CompressOnTheFly enables compressing matching files on demand
+		// when no precompressed `.br`/`.gz` sibling exists on disk, e.g.
+		// for user-uploaded files under Root that weren't built with
+		// precompression. The precompressed-sibling path remains the
+		// zero-cost fast path and is always tried first.
+		// Optional. Default value false.
+		CompressOnTheFly bool `yaml:"compressOnTheFly"`
+
+		// MinCompressSize is the minimum file size, in bytes, for
+		// CompressOnTheFly to kick in. Files smaller than this are served
+		// as-is, since compression overhead isn't worth it.
+		// Optional. Default value 0 (no minimum).
+		MinCompressSize int `yaml:"minCompressSize"`
+
+		// CompressibleTypes lists the MIME types (or "type/*" wildcards)
+		// eligible for CompressOnTheFly, matched against the file's
+		// extension. Optional. Defaults to defaultCompressibleTypes.
+		CompressibleTypes []string `yaml:"compressibleTypes"`
+
+		// CompressCacheSize is the number of on-the-fly compressed results
+		// to keep in an LRU cache, amortizing compression cost across
+		// requests for the same file.
+		// Optional. Default value 0 (no caching; compress every request).
+		CompressCacheSize int `yaml:"compressCacheSize"`
+
+		// FollowSymlinks, when false, rejects any resolved path whose real
+		// location (after following symlinks) falls outside Root, guarding
+		// against symlinks planted inside Root that point elsewhere on
+		// disk. Has no effect when Filesystem is set to something other
+		// than the OS filesystem, since there are no symlinks to escape
+		// through. When Filesystem is an http.Dir, its directory takes the
+		// place of Root for this check.
+		// Optional. Default value false.
+		FollowSymlinks bool `yaml:"followSymlinks"`
+
+		// OnSecurityViolation, if set, is called whenever FollowSymlinks is
+		// false and a request resolves outside Root, so operators can log
+		// and alert on traversal attempts distinctly from ordinary 404s.
+		// The request is still answered with a plain 404.
+		OnSecurityViolation func(c echo.Context, path string, err error)
 	}
 )
 
+// defaultCompressibleTypes is used when CompressOnTheFly is enabled and
+// CompressibleTypes is left unset.
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// defaultETagCacheSize bounds the per-instance ETag cache when
+// config.ETagCacheSize isn't set.
+const defaultETagCacheSize = 1024
+
+// etagCacheKey identifies a served file variant for the purpose of caching
+// its computed ETag, since the same path can be served as multiple distinct
+// encodings (gzip, br, identity).
+type etagCacheKey struct {
+	path     string
+	encoding string
+}
+
+// etagCacheEntry holds the ETag computed for a file as of a given ModTime,
+// so unchanged precompressed assets are not re-hashed on every request.
+type etagCacheEntry struct {
+	key     etagCacheKey
+	modTime time.Time
+	etag    string
+}
+
+// etagCache is a small bounded LRU cache for computed ETags, owned by a
+// single middleware instance - like compressCache, not a package-level
+// global. Two instances serving different Filesystems at overlapping
+// relative paths (e.g. two independently embedded SPAs, each with their own
+// index.html) therefore never hand out each other's ETag, which matters
+// because embed.FS.ModTime always returns the zero time and so can't be
+// relied on to tell their files apart. Bounding it also caps memory for
+// servers with many distinct paths/encodings.
+type etagCache struct {
+	mu       sync.Mutex
+	maxSize  int
+	order    *list.List
+	elements map[etagCacheKey]*list.Element
+}
+
+func newETagCache(maxSize int) *etagCache {
+	return &etagCache{
+		maxSize:  maxSize,
+		order:    list.New(),
+		elements: make(map[etagCacheKey]*list.Element),
+	}
+}
+
+func (cache *etagCache) get(key etagCacheKey, modTime time.Time) (string, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	el, ok := cache.elements[key]
+
+	if !ok {
+		return "", false
+	}
+
+	entry := el.Value.(*etagCacheEntry)
+
+	if !entry.modTime.Equal(modTime) {
+		cache.order.Remove(el)
+		delete(cache.elements, key)
+		return "", false
+	}
+
+	cache.order.MoveToFront(el)
+
+	return entry.etag, true
+}
+
+func (cache *etagCache) set(key etagCacheKey, modTime time.Time, etag string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if el, ok := cache.elements[key]; ok {
+		el.Value.(*etagCacheEntry).modTime = modTime
+		el.Value.(*etagCacheEntry).etag = etag
+		cache.order.MoveToFront(el)
+		return
+	}
+
+	cache.elements[key] = cache.order.PushFront(&etagCacheEntry{key: key, modTime: modTime, etag: etag})
+
+	if cache.order.Len() > cache.maxSize {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.elements, oldest.Value.(*etagCacheEntry).key)
+	}
+}
+
 var (
 	// DefaultStaticConfig is the default Static middleware config.
 	DefaultStaticConfig = StaticConfig{
@@ -86,7 +263,33 @@ func MiddlewareWithConfig(config StaticConfig) echo.MiddlewareFunc {
 		panic("length of encodings and extensions must match")
 	}
 
-	fs := http.Dir(config.Root)
+	if config.CompressOnTheFly && config.CompressibleTypes == nil {
+		config.CompressibleTypes = defaultCompressibleTypes
+	}
+
+	if config.ETagCacheSize <= 0 {
+		config.ETagCacheSize = defaultETagCacheSize
+	}
+
+	etags := newETagCache(config.ETagCacheSize)
+
+	fs := config.Filesystem
+
+	if fs == nil {
+		fs = http.Dir(config.Root)
+	}
+
+	var compCache *compressCache
+
+	if config.CompressCacheSize > 0 {
+		compCache = newCompressCache(config.CompressCacheSize)
+	}
+
+	var rootResolved string
+
+	if !config.FollowSymlinks {
+		rootResolved = resolveRoot(fs)
+	}
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
@@ -95,8 +298,9 @@ func MiddlewareWithConfig(config StaticConfig) echo.MiddlewareFunc {
 			}
 
 			p := c.Request().URL.Path
+			wildcardRoute := strings.HasSuffix(c.Path(), "*")
 
-			if strings.HasSuffix(c.Path(), "*") { // When serving from a group, e.g. `/static*`.
+			if wildcardRoute { // When serving from a group, e.g. `/static*`.
 				p = c.Param("*")
 			}
 
@@ -108,14 +312,47 @@ func MiddlewareWithConfig(config StaticConfig) echo.MiddlewareFunc {
 
 			p = filepath.Clean("/" + p) // "/"+ for security
 
+			// A wildcard route already has the group's mount path stripped
+			// from p by echo's router (c.Param("*") never includes it), so
+			// IgnoreBase only has something to do for other route shapes -
+			// applying it to a wildcard route's already-stripped p risks
+			// mangling a real file whose name coincides with the last
+			// segment of the mount path.
+			if config.IgnoreBase && !wildcardRoute {
+				// The group's mount path is whatever precedes the route's
+				// final segment (the named param, here), so stripping that
+				// prefix covers a static middleware mounted on a
+				// non-wildcard route - the "doubling" IgnoreBase's doc
+				// comment promises to avoid.
+				if groupPath := strings.TrimSuffix(path.Dir(c.Path()), "/"); groupPath != "" {
+					// Match on a path-segment boundary so a real file whose
+					// basename merely starts with the group path (e.g.
+					// group "/v1" and a file "/v1additional.json") isn't
+					// mangled.
+					if rest := strings.TrimPrefix(p, groupPath); rest != p && (rest == "" || rest[0] == '/') {
+						p = filepath.Clean("/" + rest)
+					}
+				}
+			}
+
 			// Short circuit
 			if p == "/" {
 				p = config.Index
 			}
 
-			f, err := openFile(c, fs, p, config.Encodings, config.EncodingExtensions)
+			// Negotiation is attempted for every file request, so the response
+			// always depends on Accept-Encoding - even a 404 or an identity
+			// response, since a compressed sibling might appear later.
+			if len(config.Encodings) > 0 {
+				c.Response().Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			}
+
+			f, _, err := openFile(c, fs, p, config, compCache, rootResolved)
 
 			if err != nil {
+				if errors.Is(err, errNotAcceptable) {
+					return echo.NewHTTPError(http.StatusNotAcceptable)
+				}
 
 				// Any error other than "Not exists" is an error
 				if !os.IsNotExist(err) {
@@ -130,7 +367,7 @@ func MiddlewareWithConfig(config StaticConfig) echo.MiddlewareFunc {
 				// Route everything to index in SPA mode
 				if config.HTML5 {
 					p = config.Index
-					f, err = fs.Open(p)
+					f, err = safeOpen(c, fs, config, rootResolved, p)
 
 					if err != nil {
 						return echo.ErrNotFound
@@ -150,13 +387,17 @@ func MiddlewareWithConfig(config StaticConfig) echo.MiddlewareFunc {
 				// Route everything to index in SPA mode
 				if config.HTML5 {
 					p = config.Index
-					f, err = fs.Open(p)
+					f, err = safeOpen(c, fs, config, rootResolved, p)
 				} else {
 					p = filepath.Join(p, config.Index)
-					f, err = openFile(c, fs, p, config.Encodings, config.EncodingExtensions)
+					f, _, err = openFile(c, fs, p, config, compCache, rootResolved)
 				}
 
 				if err != nil {
+					if errors.Is(err, errNotAcceptable) {
+						return echo.NewHTTPError(http.StatusNotAcceptable)
+					}
+
 					return echo.ErrNotFound
 				}
 
@@ -167,31 +408,442 @@ func MiddlewareWithConfig(config StaticConfig) echo.MiddlewareFunc {
 				}
 			}
 
-			return serveFile(c, f, info, p)
+			return serveFile(c, config, etags, f, info, p)
 		}
 	}
 }
 
-func openFile(c echo.Context, fs http.FileSystem, p string, encodings []string, encodingExtensions []string) (file http.File, err error) {
-	if acceptEncoding := c.Request().Header.Get(echo.HeaderAcceptEncoding); acceptEncoding != "" {
-		for i, enc := range encodings {
-			if !strings.Contains(acceptEncoding, enc) {
+// openFile opens p, preferring a precompressed sibling matching one of the
+// client's accepted encodings - in the server's configured preference order,
+// not the client's - and reports which encoding (if any) was picked so the
+// caller can tailor caching and response headers accordingly. If the client
+// explicitly rejects every coding the middleware could serve, it returns
+// errNotAcceptable instead of silently falling back to identity. When no
+// precompressed sibling exists and config.CompressOnTheFly is set, an
+// eligible file is compressed on demand instead.
+func openFile(c echo.Context, fs http.FileSystem, p string, config StaticConfig, cache *compressCache, rootResolved string) (file http.File, encoding string, err error) {
+	acceptEncoding := c.Request().Header.Get(echo.HeaderAcceptEncoding)
+
+	if acceptEncoding == "" {
+		file, err = safeOpen(c, fs, config, rootResolved, p)
+		return
+	}
+
+	accepted := parseAcceptEncoding(acceptEncoding)
+
+	for i, enc := range config.Encodings {
+		if acceptableQ(accepted, enc) <= 0 {
+			continue
+		}
+
+		if file, err = safeOpen(c, fs, config, rootResolved, p+config.EncodingExtensions[i]); err == nil {
+			encoding = enc
+			c.Response().Header().Set(echo.HeaderContentEncoding, encoding)
+			return
+		}
+	}
+
+	if config.CompressOnTheFly {
+		for _, enc := range config.Encodings {
+			if acceptableQ(accepted, enc) <= 0 {
 				continue
 			}
 
-			if file, err = fs.Open(p + encodingExtensions[i]); err == nil {
-				c.Response().Header().Set(echo.HeaderContentEncoding, encodings[i])
+			if file, err = compressOnTheFly(c, fs, p, enc, config, cache, rootResolved); err == nil {
+				encoding = enc
+				c.Response().Header().Set(echo.HeaderContentEncoding, encoding)
 				return
 			}
 		}
 	}
 
-	file, err = fs.Open(p)
+	if acceptableQ(accepted, "identity") <= 0 {
+		err = errNotAcceptable
+		return
+	}
+
+	file, err = safeOpen(c, fs, config, rootResolved, p)
 
 	return
 }
 
-func serveFile(c echo.Context, file http.File, info os.FileInfo, name string) error {
+// resolveRoot returns the real (symlink-resolved) absolute path backing fs,
+// or "" if it can't be resolved yet (e.g. the directory doesn't exist) or fs
+// isn't an OS-backed http.Dir. It derives the path from fs itself - not from
+// config.Root - since config.Filesystem may be an http.Dir rooted somewhere
+// other than config.Root entirely.
+func resolveRoot(fs http.FileSystem) string {
+	dir, ok := fs.(http.Dir)
+
+	if !ok {
+		return ""
+	}
+
+	resolved, err := filepath.EvalSymlinks(string(dir))
+
+	if err != nil {
+		return ""
+	}
+
+	return resolved
+}
+
+// safeOpen opens p through fs, first enforcing the symlink policy: when
+// rootResolved is set, p must resolve to a location inside it. A violation
+// is reported via config.OnSecurityViolation (if set) and returned wrapping
+// errSecurityViolation, which the caller treats like any other open error -
+// it never satisfies os.IsNotExist, so it surfaces as an ordinary 404
+// without leaking the underlying cause to the client.
+func safeOpen(c echo.Context, fs http.FileSystem, config StaticConfig, rootResolved, p string) (http.File, error) {
+	if rootResolved != "" {
+		if dir, ok := fs.(http.Dir); ok {
+			if resolved, err := filepath.EvalSymlinks(filepath.Join(string(dir), p)); err == nil {
+				if resolved != rootResolved && !strings.HasPrefix(resolved, rootResolved+string(filepath.Separator)) {
+					violation := fmt.Errorf("%w: %q resolves to %q", errSecurityViolation, p, resolved)
+
+					if config.OnSecurityViolation != nil {
+						config.OnSecurityViolation(c, p, violation)
+					}
+
+					return nil, violation
+				}
+			}
+		}
+	}
+
+	return fs.Open(p)
+}
+
+// compressCacheKey identifies a cached on-the-fly compression result.
+type compressCacheKey struct {
+	path     string
+	encoding string
+}
+
+// compressCacheEntry is a cached on-the-fly compression result, valid only
+// while the source file's ModTime matches.
+type compressCacheEntry struct {
+	key     compressCacheKey
+	modTime time.Time
+	data    []byte
+}
+
+// compressCache is a small bounded LRU cache for on-the-fly compressed
+// output, amortizing compression cost across requests for the same source
+// file. Safe for concurrent use.
+type compressCache struct {
+	mu       sync.Mutex
+	maxSize  int
+	order    *list.List
+	elements map[compressCacheKey]*list.Element
+}
+
+func newCompressCache(maxSize int) *compressCache {
+	return &compressCache{
+		maxSize:  maxSize,
+		order:    list.New(),
+		elements: make(map[compressCacheKey]*list.Element),
+	}
+}
+
+func (cache *compressCache) get(key compressCacheKey, modTime time.Time) ([]byte, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	el, ok := cache.elements[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*compressCacheEntry)
+
+	if !entry.modTime.Equal(modTime) {
+		cache.order.Remove(el)
+		delete(cache.elements, key)
+		return nil, false
+	}
+
+	cache.order.MoveToFront(el)
+
+	return entry.data, true
+}
+
+func (cache *compressCache) set(key compressCacheKey, modTime time.Time, data []byte) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if el, ok := cache.elements[key]; ok {
+		el.Value.(*compressCacheEntry).modTime = modTime
+		el.Value.(*compressCacheEntry).data = data
+		cache.order.MoveToFront(el)
+		return
+	}
+
+	cache.elements[key] = cache.order.PushFront(&compressCacheEntry{key: key, modTime: modTime, data: data})
+
+	if cache.order.Len() > cache.maxSize {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.elements, oldest.Value.(*compressCacheEntry).key)
+	}
+}
+
+// compressOnTheFly compresses p into encoding when it isn't precompressed on
+// disk, provided it passes the size and content-type eligibility checks.
+// Results are served from cache when available.
+func compressOnTheFly(c echo.Context, fs http.FileSystem, p, encoding string, config StaticConfig, cache *compressCache, rootResolved string) (http.File, error) {
+	if encoding != "gzip" && encoding != "br" {
+		return nil, fmt.Errorf("staticgzip: unsupported on-the-fly encoding %q", encoding)
+	}
+
+	if !isCompressibleType(p, config.CompressibleTypes) {
+		return nil, fmt.Errorf("staticgzip: %q is not a compressible type", p)
+	}
+
+	src, err := safeOpen(c, fs, config, rootResolved, p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer src.Close()
+
+	info, err := src.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() || info.Size() < int64(config.MinCompressSize) {
+		return nil, fmt.Errorf("staticgzip: %q is not eligible for on-the-fly compression", p)
+	}
+
+	key := compressCacheKey{path: p, encoding: encoding}
+
+	if cache != nil {
+		if data, ok := cache.get(key, info.ModTime()); ok {
+			return newMemFile(data, info), nil
+		}
+	}
+
+	data, err := compressBytes(src, encoding)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		cache.set(key, info.ModTime(), data)
+	}
+
+	return newMemFile(data, info), nil
+}
+
+// compressBytes compresses r's contents with encoding, which must be "gzip"
+// or "br".
+func compressBytes(r io.Reader, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	var w io.WriteCloser
+
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("staticgzip: unsupported on-the-fly encoding %q", encoding)
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// isCompressibleType reports whether p's extension maps to one of types,
+// which may contain exact MIME types or "type/*" wildcards.
+func isCompressibleType(p string, types []string) bool {
+	contentType := mime.TypeByExtension(filepath.Ext(p))
+
+	if contentType == "" {
+		return false
+	}
+
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	for _, t := range types {
+		if strings.HasSuffix(t, "/*") {
+			if strings.HasPrefix(contentType, t[:len(t)-1]) {
+				return true
+			}
+
+			continue
+		}
+
+		if contentType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sizedFileInfo overrides Size() to reflect compressed output while keeping
+// the source file's name and ModTime.
+type sizedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i sizedFileInfo) Size() int64 { return i.size }
+
+// memFile adapts an in-memory byte slice to the http.File interface, used to
+// serve on-the-fly compressed output that has no backing file on disk.
+type memFile struct {
+	*bytes.Reader
+	info os.FileInfo
+}
+
+func newMemFile(data []byte, sourceInfo os.FileInfo) *memFile {
+	return &memFile{
+		Reader: bytes.NewReader(data),
+		info:   sizedFileInfo{FileInfo: sourceInfo, size: int64(len(data))},
+	}
+}
+
+func (f *memFile) Close() error { return nil }
+
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+// acceptEncoding is a single content-coding/qvalue pair from a parsed
+// Accept-Encoding header.
+type acceptEncoding struct {
+	coding string
+	q      float64
+}
+
+// parseAcceptEncoding parses an Accept-Encoding header into its content-
+// coding/qvalue pairs per RFC 7231 §5.3.4. Unlike a naive substring match,
+// this correctly distinguishes "gzip" from "x-gzip" and honors q-values.
+func parseAcceptEncoding(header string) []acceptEncoding {
+	fields := strings.Split(header, ",")
+	parsed := make([]acceptEncoding, 0, len(fields))
+
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+
+		if field == "" {
+			continue
+		}
+
+		coding, q := field, 1.0
+
+		if i := strings.IndexByte(field, ';'); i >= 0 {
+			coding = strings.TrimSpace(field[:i])
+
+			if j := strings.Index(field[i+1:], "q="); j >= 0 {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(field[i+1+j+2:]), 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		parsed = append(parsed, acceptEncoding{coding: strings.ToLower(coding), q: q})
+	}
+
+	return parsed
+}
+
+// acceptableQ returns the q-value the client assigned to coding. Per RFC
+// 7231, identity is always acceptable unless explicitly or wildcard-
+// rejected, while every other coding requires an explicit or wildcard match.
+func acceptableQ(parsed []acceptEncoding, coding string) float64 {
+	wildcard := -1.0
+
+	for _, p := range parsed {
+		if p.coding == coding {
+			return p.q
+		}
+
+		if p.coding == "*" {
+			wildcard = p.q
+		}
+	}
+
+	if wildcard >= 0 {
+		return wildcard
+	}
+
+	if coding == "identity" {
+		return 1
+	}
+
+	return 0
+}
+
+func serveFile(c echo.Context, config StaticConfig, etags *etagCache, file http.File, info os.FileInfo, name string) error {
+	encoding := c.Response().Header().Get(echo.HeaderContentEncoding)
+
+	etag, err := computeETag(etags, file, name, encoding, info.ModTime())
+
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", etag)
+
+	if config.CacheControl != "" {
+		c.Response().Header().Set("Cache-Control", config.CacheControl)
+	}
+
 	http.ServeContent(c.Response(), c.Request(), path.Base(name), info.ModTime(), file)
 	return nil
 }
+
+// computeETag returns a strong, quoted ETag for the given file, scoped to
+// its encoding variant so a gzip response and an identity response never
+// collide in shared caches. Since precompressed assets are immutable at
+// build time, the result is cached by (path, encoding) and only
+// recomputed when ModTime changes.
+func computeETag(cache *etagCache, file http.File, name, encoding string, modTime time.Time) (string, error) {
+	key := etagCacheKey{path: name, encoding: encoding}
+
+	if etag, ok := cache.get(key, modTime); ok {
+		return etag, nil
+	}
+
+	prefix := encoding
+
+	if prefix == "" {
+		prefix = "identity"
+	}
+
+	h := sha1.New()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + prefix + "-" + hex.EncodeToString(h.Sum(nil)) + `"`
+
+	cache.set(key, modTime, etag)
+
+	return etag, nil
+}
@@ -0,0 +1,438 @@
+package staticgzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// zeroModTimeFile is an http.File whose ModTime is always the zero time,
+// mimicking embed.FS - the case in which an ETag cache shared across
+// instances and keyed only on (path, encoding) would collide across
+// unrelated Filesystems.
+type zeroModTimeFile struct {
+	*bytes.Reader
+	name string
+}
+
+func (f *zeroModTimeFile) Close() error                       { return nil }
+func (f *zeroModTimeFile) Readdir(int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *zeroModTimeFile) Stat() (os.FileInfo, error)         { return f, nil }
+func (f *zeroModTimeFile) Name() string                       { return f.name }
+func (f *zeroModTimeFile) Size() int64                        { return f.Reader.Size() }
+func (f *zeroModTimeFile) Mode() os.FileMode                  { return 0o644 }
+func (f *zeroModTimeFile) ModTime() time.Time                 { return time.Time{} }
+func (f *zeroModTimeFile) IsDir() bool                        { return false }
+func (f *zeroModTimeFile) Sys() interface{}                   { return nil }
+
+type zeroModTimeFS struct {
+	content []byte
+}
+
+func (fs zeroModTimeFS) Open(name string) (http.File, error) {
+	return &zeroModTimeFile{Reader: bytes.NewReader(fs.content), name: name}, nil
+}
+
+func TestIgnoreBaseOnlyStripsExactBasenameMatch(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "v1additional.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	h := MiddlewareWithConfig(StaticConfig{Root: dir, IgnoreBase: true})(func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/v1additional.json", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/v1/*")
+	c.SetParamNames("*")
+	c.SetParamValues("v1additional.json")
+
+	if err := h(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /v1/v1additional.json to be served as-is, got status %d", rec.Code)
+	}
+}
+
+// TestIgnoreBaseStripsGroupMountPrefixOnNonWildcardRoute drives the
+// middleware through echo's real router (not a hand-built context) to
+// exercise the "doubling" scenario IgnoreBase's doc comment promises to
+// fix: a static middleware mounted on a non-wildcard route never has the
+// group's mount path pre-stripped from the request path by echo, unlike
+// a wildcard route's c.Param("*").
+func TestIgnoreBaseStripsGroupMountPrefixOnNonWildcardRoute(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "app.js"), []byte(`console.log(1)`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	g := e.Group("/v1", MiddlewareWithConfig(StaticConfig{Root: dir, IgnoreBase: true}))
+	g.GET("/:file", func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/app.js", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /v1/app.js to resolve to Root/app.js via the real router, got status %d", rec.Code)
+	}
+}
+
+// TestIgnoreBaseLeavesWildcardRouteFilesAlone guards against IgnoreBase
+// corrupting a legitimate request on a wildcard route: echo's router
+// already strips the group's mount path into c.Param("*"), so a real
+// file whose name coincides with the mount path's last segment (e.g.
+// group "/v1" and a file literally named "v1") must still be served
+// as-is, not silently collapsed to "/" (and thus to Index).
+func TestIgnoreBaseLeavesWildcardRouteFilesAlone(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(`<index>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "v1"), []byte(`not the index`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	g := e.Group("/v1", MiddlewareWithConfig(StaticConfig{Root: dir, IgnoreBase: true}))
+	g.GET("/*", func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/v1", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /v1/v1 to resolve, got status %d", rec.Code)
+	}
+
+	if rec.Body.String() != "not the index" {
+		t.Fatalf("expected the literal file %q to be served, got body %q", "v1", rec.Body.String())
+	}
+}
+
+// TestETagCacheIsScopedPerInstance guards against two middleware instances
+// serving different Filesystems - each with zero ModTimes, like embed.FS -
+// handing out the same ETag for the same relative path.
+func TestETagCacheIsScopedPerInstance(t *testing.T) {
+	etagFor := func(content []byte) string {
+		e := echo.New()
+		h := MiddlewareWithConfig(StaticConfig{Filesystem: zeroModTimeFS{content: content}})(func(c echo.Context) error {
+			return echo.ErrNotFound
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := h(c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return rec.Header().Get("ETag")
+	}
+
+	a := etagFor([]byte("app A"))
+	b := etagFor([]byte("app B"))
+
+	if a == "" || b == "" {
+		t.Fatalf("expected non-empty ETags, got %q and %q", a, b)
+	}
+
+	if a == b {
+		t.Fatalf("two instances serving different content produced the same ETag %q", a)
+	}
+}
+
+// TestETagCacheEvictsOldestBeyondMaxSize guards against the ETag cache
+// growing without bound.
+func TestETagCacheEvictsOldestBeyondMaxSize(t *testing.T) {
+	cache := newETagCache(2)
+
+	now := time.Now()
+
+	cache.set(etagCacheKey{path: "/a"}, now, "etag-a")
+	cache.set(etagCacheKey{path: "/b"}, now, "etag-b")
+	cache.set(etagCacheKey{path: "/c"}, now, "etag-c")
+
+	if _, ok := cache.get(etagCacheKey{path: "/a"}, now); ok {
+		t.Fatal("expected the least recently used entry to have been evicted")
+	}
+
+	if _, ok := cache.get(etagCacheKey{path: "/c"}, now); !ok {
+		t.Fatal("expected the most recently added entry to still be cached")
+	}
+}
+
+// TestSymlinkPolicyUsesFilesystemRootNotConfigRoot guards against the
+// symlink-escape check resolving its root from config.Root when
+// config.Filesystem points an http.Dir somewhere else entirely - the natural
+// way to use the Filesystem field without also setting Root.
+func TestSymlinkPolicyUsesFilesystemRootNotConfigRoot(t *testing.T) {
+	realRoot := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(realRoot, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(realRoot, "sub", "data.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	h := MiddlewareWithConfig(StaticConfig{Filesystem: http.Dir(realRoot)})(func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/sub/data.json", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if err := h(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected a legitimate file under Filesystem's real root to be served, got status %d", rec.Code)
+	}
+}
+
+// TestSymlinkEscapeIsRejected guards the actual security property this
+// request exists to provide: a symlink planted inside Root that points
+// outside it must be refused with a 404 (never leaked to the client as a
+// distinguishable error) and must fire OnSecurityViolation.
+func TestSymlinkEscapeIsRejected(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	secret := filepath.Join(outside, "secret.txt")
+
+	if err := os.WriteFile(secret, []byte("do not serve me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(secret, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	var violations int
+
+	e := echo.New()
+	h := MiddlewareWithConfig(StaticConfig{
+		Root: root,
+		OnSecurityViolation: func(c echo.Context, path string, err error) {
+			violations++
+		},
+	})(func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/escape", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := h(c)
+
+	httpErr, ok := err.(*echo.HTTPError)
+
+	if !ok || httpErr.Code != http.StatusNotFound {
+		t.Fatalf("expected a 404 HTTPError for a symlink escaping Root, got %v", err)
+	}
+
+	if violations != 1 {
+		t.Fatalf("expected OnSecurityViolation to fire exactly once, got %d", violations)
+	}
+}
+
+func TestAcceptableQ(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		coding string
+		want   float64
+	}{
+		{"exact match", "gzip, br", "gzip", 1},
+		{"q-value honored", "gzip;q=0.5, br;q=0.8", "br", 0.8},
+		{"explicit rejection", "gzip;q=0, br", "gzip", 0},
+		{"x-gzip does not match gzip", "x-gzip", "gzip", 0},
+		{"unlisted coding defaults to rejected", "gzip", "br", 0},
+		{"identity implicitly acceptable", "gzip", "identity", 1},
+		{"identity explicitly rejected", "gzip, identity;q=0", "identity", 0},
+		{"wildcard covers unlisted coding", "*;q=0.3", "br", 0.3},
+		{"explicit entry overrides wildcard", "*;q=0, gzip;q=1", "gzip", 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := acceptableQ(parseAcceptEncoding(tc.header), tc.coding)
+
+			if got != tc.want {
+				t.Errorf("acceptableQ(%q, %q) = %v, want %v", tc.header, tc.coding, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOpenFileReturns406WhenEveryEncodingIsRejected(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	h := MiddlewareWithConfig(StaticConfig{Root: dir})(func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	req.Header.Set("Accept-Encoding", "identity;q=0, *;q=0")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := h(c)
+
+	if err == nil {
+		t.Fatal("expected an error for a fully rejected Accept-Encoding header")
+	}
+
+	httpErr, ok := err.(*echo.HTTPError)
+
+	if !ok || httpErr.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected a 406 HTTPError, got %v", err)
+	}
+}
+
+// TestVaryAcceptEncodingIsSetWheneverNegotiationIsAttempted guards the
+// header this request exists to add: any response where encoding
+// negotiation takes place - including a 404 for a missing file - must vary
+// on Accept-Encoding, since a compressed sibling could appear later.
+func TestVaryAcceptEncodingIsSetWheneverNegotiationIsAttempted(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	h := MiddlewareWithConfig(StaticConfig{Root: dir})(func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/missing.html", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	_ = h(c)
+
+	if got := rec.Header().Get(echo.HeaderVary); got != echo.HeaderAcceptEncoding {
+		t.Fatalf("expected Vary: %s even for a 404, got %q", echo.HeaderAcceptEncoding, got)
+	}
+}
+
+// TestVaryAcceptEncodingIsOmittedWhenNegotiationIsDisabled guards the flip
+// side: with Encodings explicitly emptied (negotiation disabled), no Vary
+// header should be added.
+func TestVaryAcceptEncodingIsOmittedWhenNegotiationIsDisabled(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	h := MiddlewareWithConfig(StaticConfig{
+		Root:               dir,
+		Encodings:          []string{},
+		EncodingExtensions: []string{},
+	})(func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if err := h(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := rec.Header().Get(echo.HeaderVary); got != "" {
+		t.Fatalf("expected no Vary header with negotiation disabled, got %q", got)
+	}
+}
+
+// TestCompressOnTheFlyServesGzippedContent is a happy-path check for
+// CompressOnTheFly: a compressible file with no precompressed .gz sibling,
+// requested with a gzip-accepting client, should come back Content-Encoding:
+// gzip and decompress to the original bytes.
+func TestCompressOnTheFlyServesGzippedContent(t *testing.T) {
+	dir := t.TempDir()
+
+	content := strings.Repeat("hello on-the-fly gzip\n", 100)
+
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	h := MiddlewareWithConfig(StaticConfig{
+		Root:             dir,
+		CompressOnTheFly: true,
+		MinCompressSize:  1,
+	})(func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/data.json", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if err := h(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected Content-Encoding: gzip, got %q", rec.Header().Get("Content-Encoding"))
+	}
+
+	gr, err := gzip.NewReader(rec.Body)
+
+	if err != nil {
+		t.Fatalf("response body is not valid gzip: %v", err)
+	}
+
+	decompressed, err := io.ReadAll(gr)
+
+	if err != nil {
+		t.Fatalf("failed to decompress response body: %v", err)
+	}
+
+	if string(decompressed) != content {
+		t.Fatalf("decompressed body does not match original content")
+	}
+}